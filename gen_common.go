@@ -0,0 +1,185 @@
+//go:build ignore
+// +build ignore
+
+// gen_common.go holds the go/types plumbing shared by the source generators
+// in this package (msg_generate.go, json_generate.go, fuzz_generate.go):
+// loading the github.com/miekg/dns package, walking its scope to find RR
+// struct types, and building canonical per-tag seed values so fuzz and JSON
+// round-trip tests exercise the same wire-valid instances. Run each
+// generator as e.g. `go run msg_generate.go gen_common.go`.
+package main
+
+import (
+	"go/types"
+	"log"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// seedExpr returns a Go expression literal that produces a minimal,
+// wire-valid value for a field carrying the given dns struct tag,
+// dispatching on the tag the same way the pack/unpack generators do
+// rather than just the field's Go kind. A string tagged dns:"hex" needs
+// actual hex digits, not an arbitrary literal, or rr.pack on the seed
+// fails before the consumer even gets to exercise it. ok is false when the
+// field should be left at its Go zero value.
+//
+// Shared by fuzz_generate.go (the FuzzRR_<Name> corpus seed) and
+// json_generate.go (the TestJSONRoundTrip_<Name> seed), so both exercise
+// the same canonical instances per RR type.
+func seedExpr(tag string, typ types.Type) (expr string, ok bool) {
+	switch {
+	case tag == `dns:"a"`:
+		return "net.IPv4(127, 0, 0, 1).To4()", true
+	case tag == `dns:"aaaa"`:
+		return `net.ParseIP("::1")`, true
+	case tag == `dns:"cdomain-name"`, tag == `dns:"domain-name"`:
+		return `"example."`, true
+	case tag == `dns:"hex"`, strings.HasPrefix(tag, `dns:"size-hex`):
+		// One byte of hex, matching the "1" every untagged integer
+		// field below is seeded with — including whatever *Length
+		// field a size-hex:<Field> tag elsewhere on this struct
+		// refers to.
+		return `"01"`, true
+	case tag == `dns:"base32"`, strings.HasPrefix(tag, `dns:"size-base32`):
+		// One zero byte in unpadded base32 (the encoding NSEC3 uses
+		// for its salt/hash).
+		return `"00"`, true
+	case tag == `dns:"base64"`, strings.HasPrefix(tag, `dns:"size-base64`):
+		// One zero byte in standard padded base64.
+		return `"AA=="`, true
+	case tag == `dns:"uint48"`:
+		return "1", true
+	case tag == `dns:"any"`, tag == `dns:"octet"`, tag == `dns:"txt"`:
+		return `"x"`, true
+	case tag == `dns:"ipsechost"`, tag == `dns:"amtrelayhost"`:
+		// Leave the host at its zero value; callers that want to
+		// exercise the IP-gateway branch instead set GatewayType and
+		// GatewayAddr themselves.
+		return "", false
+	case tag == "":
+		if bt, ok := typ.(*types.Basic); ok {
+			if bt.Kind() == types.String {
+				return `"x"`, true
+			}
+			return "1", true
+		}
+		if isNetIP(typ) {
+			return "net.IPv4(127, 0, 0, 1).To4()", true
+		}
+		return "", false
+	default:
+		return "", false
+	}
+}
+
+// isNetIP reports whether typ is net.IP, the named []byte type A and AAAA
+// use for their address fields. Such fields are neither *types.Slice (it's
+// a *types.Named wrapping one) nor handled by the plain dns:"a"/"aaaa" tag
+// cases, so an untagged net.IP field is seeded here. The IPSECKEY/AMTRELAY
+// GatewayAddr is tagged dns:"-" and never reaches seedExpr.
+func isNetIP(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == "net" && obj.Name() == "IP"
+}
+
+// domainNameUnstable reports whether this RR type has a cdomain-name or
+// domain-name RDATA field. Such fields can come back from unpack
+// downcased, and pack's compression choices for them aren't guaranteed to
+// repeat byte-for-byte between two otherwise-equivalent RRs, so a
+// byte-for-byte round-trip comparison on them needs to compare a second
+// round trip's result against the first rather than the repacked bytes
+// against the original corpus entry.
+func domainNameUnstable(st *types.Struct) bool {
+	for i := 1; i < st.NumFields(); i++ {
+		switch st.Tag(i) {
+		case `dns:"cdomain-name"`, `dns:"domain-name"`:
+			return true
+		}
+	}
+	return false
+}
+
+// getTypeStruct will take a type and the package scope, and return the
+// (innermost) struct if the type is considered a RR type (currently defined as
+// those structs beginning with a RR_Header, could be redefined as implementing
+// the RR interface). The bool return value indicates if embedded structs were
+// resolved.
+func getTypeStruct(t types.Type, scope *types.Scope) (*types.Struct, bool) {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil, false
+	}
+	if st.NumFields() == 0 {
+		return nil, false
+	}
+	if st.Field(0).Type() == scope.Lookup("RR_Header").Type() {
+		return st, false
+	}
+	if st.Field(0).Anonymous() {
+		st, _ := getTypeStruct(st.Field(0).Type(), scope)
+		return st, true
+	}
+	return nil, false
+}
+
+// loadModule retrieves package description for a given module.
+func loadModule(name string) (*types.Package, error) {
+	conf := packages.Config{Mode: packages.NeedTypes | packages.NeedTypesInfo}
+	pkgs, err := packages.Load(&conf, name)
+	if err != nil {
+		return nil, err
+	}
+	return pkgs[0].Types, nil
+}
+
+// namedRRTypes walks scope and returns the names of every exported RR struct
+// type, in the same order and subject to the same exclusions (PrivateRR, and
+// RR types missing a corresponding TypeX constant) used by msg_generate.go.
+func namedRRTypes(scope *types.Scope) []string {
+	var namedTypes []string
+	for _, name := range scope.Names() {
+		o := scope.Lookup(name)
+		if o == nil || !o.Exported() {
+			continue
+		}
+		if st, _ := getTypeStruct(o.Type(), scope); st == nil {
+			continue
+		}
+		if name == "PrivateRR" {
+			continue
+		}
+
+		// Check if corresponding TypeX exists
+		if scope.Lookup("Type"+o.Name()) == nil && o.Name() != "RFC3597" {
+			log.Fatalf("Constant Type%s does not exist.", o.Name())
+		}
+
+		namedTypes = append(namedTypes, o.Name())
+	}
+	return namedTypes
+}
+
+// structMember will take a tag like dns:"size-base32:SaltLength" and return the last part of this string.
+func structMember(s string) string {
+	idx := strings.LastIndex(s, ":")
+	return strings.TrimSuffix(s[idx+1:], `"`)
+}
+
+// structTag will take a tag like dns:"size-base32:SaltLength" and return base32.
+func structTag(s string) string {
+	s = strings.TrimPrefix(s, `dns:"size-`)
+	s, _, _ = strings.Cut(s, ":")
+	return s
+}
+
+func fatalIfErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
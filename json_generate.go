@@ -0,0 +1,400 @@
+//go:build ignore
+// +build ignore
+
+// json_generate.go is meant to run with go generate. It shares the
+// go/{importer,types} scope-walk machinery in gen_common.go with
+// msg_generate.go, and for each RR struct type generates MarshalJSON and
+// UnmarshalJSON methods based on the same `dns:"..."` struct tags the wire
+// codecs use. The generated source is written to zjson.go, plus a
+// TestJSONRoundTrip_<Name> per RR type in zjson_test.go that exercises
+// wire -> RR -> JSON -> RR -> wire on the same canonical seed instances
+// fuzz_generate.go uses, and both are meant to be checked into git.
+//
+//	go run json_generate.go gen_common.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"log"
+	"os"
+	"strings"
+)
+
+var jsonPackageHdr = `
+// Code generated by "go run json_generate.go"; DO NOT EDIT.
+//
+// The marshal*Slice/unmarshal*Slice helpers this file's output calls for dns:"opt" and
+// dns:"pairs" fields live in json_helpers.go.
+
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+`
+
+var jsonTestPackageHdr = `
+// Code generated by "go run json_generate.go"; DO NOT EDIT.
+//
+// maxRDLengthFuzz is declared in zfuzz_test.go.
+
+package dns
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+`
+
+func main() {
+	pkg, err := loadModule("github.com/miekg/dns")
+	fatalIfErr(err)
+	scope := pkg.Scope()
+
+	namedTypes := namedRRTypes(scope)
+
+	b := &bytes.Buffer{}
+	b.WriteString(jsonPackageHdr)
+
+	fmt.Fprint(b, "// MarshalJSON/UnmarshalJSON mirror the wire fields of each RR for JSON (un)marshalling.\n\n")
+	genMarshalJSON(b, namedTypes, scope)
+	genUnmarshalJSON(b, namedTypes, scope, pkg)
+
+	res, err := format.Source(b.Bytes())
+	if err != nil {
+		b.WriteTo(os.Stderr)
+		log.Fatal(err)
+	}
+
+	f, err := os.Create("zjson.go")
+	fatalIfErr(err)
+	defer f.Close()
+	f.Write(res)
+
+	bTest := &bytes.Buffer{}
+	bTest.WriteString(jsonTestPackageHdr)
+	genJSONRoundTripTest(bTest, namedTypes, scope)
+
+	resTest, err := format.Source(bTest.Bytes())
+	if err != nil {
+		bTest.WriteTo(os.Stderr)
+		log.Fatal(err)
+	}
+
+	fTest, err := os.Create("zjson_test.go")
+	fatalIfErr(err)
+	defer fTest.Close()
+	fTest.Write(resTest)
+}
+
+// jsonFieldName lower-cases the first rune of a struct field name, giving us
+// the conventional Go-JSON camelCase name without needing a parallel set of
+// `json:"..."` tags on the RR structs themselves.
+func jsonFieldName(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// genMarshalJSON emits a MarshalJSON method per RR type that walks the same
+// fields, in the same order, as the wire pack method, converting each to
+// the already-encoded string/number form used elsewhere in this package
+// (e.g. the dotted IPv4, FQDN, or base64 string) rather than reinventing a
+// binary encoding for JSON.
+func genMarshalJSON(b *bytes.Buffer, namedTypes []string, scope *types.Scope) {
+	for _, name := range namedTypes {
+		o := scope.Lookup(name)
+		st, _ := getTypeStruct(o.Type(), scope)
+
+		fmt.Fprintf(b, "func (rr *%s) MarshalJSON() ([]byte, error) {\n", name)
+		fmt.Fprintln(b, "m := make(map[string]interface{}, 1+", st.NumFields()-1, ")")
+		fmt.Fprintln(b, `m["hdr"] = rr.Hdr`)
+		for i := 1; i < st.NumFields(); i++ {
+			field := st.Field(i).Name()
+			key := jsonFieldName(field)
+
+			if field == "GatewayAddr" {
+				// GatewayAddr is tagged dns:"-": like the wire pack
+				// method (see msg_generate.go's ipsechost/amtrelayhost
+				// case), it's folded into the sibling GatewayHost
+				// field's handling rather than carrying its own tag, so
+				// the generic dns:"-" skip below would otherwise drop
+				// the gateway address on every JSON round trip.
+				fmt.Fprintf(b, `if rr.%s != nil {
+m[%q] = rr.%s.String()
+}
+`, field, key, field)
+				continue
+			}
+
+			if st.Tag(i) == `dns:"-"` {
+				continue
+			}
+
+			if _, ok := st.Field(i).Type().(*types.Slice); ok {
+				switch st.Tag(i) {
+				case `dns:"txt"`:
+					fmt.Fprintf(b, "m[%q] = rr.%s\n", key, field)
+				case `dns:"opt"`:
+					fmt.Fprintf(b, `optJSON, err := marshalEDNS0Slice(rr.%s)
+if err != nil {
+return nil, err
+}
+m[%q] = optJSON
+`, field, key)
+				case `dns:"pairs"`:
+					fmt.Fprintf(b, `pairsJSON, err := marshalSVCBSlice(rr.%s)
+if err != nil {
+return nil, err
+}
+m[%q] = pairsJSON
+`, field, key)
+				case `dns:"nsec"`, `dns:"domain-name"`, `dns:"apl"`:
+					// These already carry their own structured
+					// representation (type bitmaps, FQDNs, APL items)
+					// that marshals fine via the default encoding.
+					fmt.Fprintf(b, "m[%q] = rr.%s\n", key, field)
+				default:
+					log.Fatalln(name, field, st.Tag(i))
+				}
+				continue
+			}
+
+			switch {
+			case strings.HasPrefix(st.Tag(i), `dns:"size-hex:SaltLength`):
+				fmt.Fprintf(b, `if rr.%s != "-" {
+m[%q] = rr.%s
+}
+`, field, key, field)
+			case st.Tag(i) == `dns:"a"`, st.Tag(i) == `dns:"aaaa"`:
+				// net.IP is a named []byte: left to the default
+				// encoding it would base64-encode the raw address
+				// bytes instead of the dotted/colon form callers
+				// actually want.
+				fmt.Fprintf(b, "m[%q] = rr.%s.String()\n", key, field)
+			case st.Tag(i) == `dns:"cdomain-name"`, st.Tag(i) == `dns:"domain-name"`,
+				st.Tag(i) == `dns:"txt"`, st.Tag(i) == `dns:"base32"`,
+				st.Tag(i) == `dns:"base64"`, st.Tag(i) == `dns:"hex"`,
+				st.Tag(i) == `dns:"any"`, st.Tag(i) == `dns:"octet"`,
+				strings.HasPrefix(st.Tag(i), `dns:"size-base32`),
+				strings.HasPrefix(st.Tag(i), `dns:"size-base64`),
+				strings.HasPrefix(st.Tag(i), `dns:"size-hex`),
+				st.Tag(i) == `dns:"uint48"`, st.Tag(i) == "":
+				// Already a string or JSON number in Go's native
+				// encoding; no further conversion needed.
+				fmt.Fprintf(b, "m[%q] = rr.%s\n", key, field)
+			case st.Tag(i) == `dns:"ipsechost"`, st.Tag(i) == `dns:"amtrelayhost"`:
+				fmt.Fprintf(b, "m[%q] = rr.%s\n", key, field)
+			default:
+				log.Fatalln(name, field, st.Tag(i))
+			}
+		}
+		fmt.Fprint(b, "return json.Marshal(m)\n}\n\n")
+	}
+}
+
+// genUnmarshalJSON emits an UnmarshalJSON method per RR type, implemented
+// in terms of a shadow struct tagged with lowerCamelCase `json:"..."` names
+// matching genMarshalJSON's keys, so the standard library does the field
+// dispatch and we only have to handle the Hdr rename plus the handful of
+// fields (net.IP, and the EDNS0/SVCBKeyValue interface slices) that can't
+// be unmarshalled directly into the RR's own field type.
+func genUnmarshalJSON(b *bytes.Buffer, namedTypes []string, scope *types.Scope, pkg *types.Package) {
+	qual := types.RelativeTo(pkg)
+	for _, name := range namedTypes {
+		o := scope.Lookup(name)
+		st, _ := getTypeStruct(o.Type(), scope)
+
+		fmt.Fprintf(b, "func (rr *%s) UnmarshalJSON(data []byte) error {\n", name)
+		fmt.Fprintf(b, "var shadow struct {\nHdr RR_Header `json:\"hdr\"`\n")
+		for i := 1; i < st.NumFields(); i++ {
+			if st.Field(i).Name() == "GatewayAddr" {
+				// See the matching case in genMarshalJSON: GatewayAddr's
+				// own tag is dns:"-", but it still needs a shadow field
+				// to come back from JSON.
+				fmt.Fprintf(b, "GatewayAddr string `json:\"%s,omitempty\"`\n", jsonFieldName("GatewayAddr"))
+				continue
+			}
+			if st.Tag(i) == `dns:"-"` {
+				continue
+			}
+			field := st.Field(i).Name()
+			key := jsonFieldName(field)
+			omitempty := ""
+			if strings.HasPrefix(st.Tag(i), `dns:"size-hex:SaltLength`) {
+				omitempty = ",omitempty"
+			}
+
+			shadowType := types.TypeString(st.Field(i).Type(), qual)
+			switch st.Tag(i) {
+			case `dns:"a"`, `dns:"aaaa"`:
+				// encoding/json can't turn a dotted/colon string back
+				// into a net.IP on its own; unmarshal it as a string
+				// and convert with net.ParseIP below instead.
+				shadowType = "string"
+			case `dns:"opt"`:
+				shadowType = "[]jsonEDNS0"
+			case `dns:"pairs"`:
+				shadowType = "[]jsonSVCBKeyValue"
+			}
+			fmt.Fprintf(b, "%s %s `json:\"%s%s\"`\n", field, shadowType, key, omitempty)
+		}
+		fmt.Fprintln(b, "}")
+		fmt.Fprintln(b, "if err := json.Unmarshal(data, &shadow); err != nil { return err }")
+		fmt.Fprintln(b, "rr.Hdr = shadow.Hdr")
+		for i := 1; i < st.NumFields(); i++ {
+			if st.Field(i).Name() == "GatewayAddr" {
+				fmt.Fprintf(b, `if shadow.GatewayAddr != "" {
+ip := net.ParseIP(shadow.GatewayAddr)
+if ip == nil {
+return fmt.Errorf("dns: invalid IP address %%q for %s.GatewayAddr", shadow.GatewayAddr)
+}
+rr.GatewayAddr = ip
+}
+`, name)
+				continue
+			}
+			if st.Tag(i) == `dns:"-"` {
+				continue
+			}
+			field := st.Field(i).Name()
+
+			if strings.HasPrefix(st.Tag(i), `dns:"size-hex:SaltLength`) {
+				// MarshalJSON omits the key entirely when the salt is "-"
+				// (no salt), so a missing key decodes to the Go zero value
+				// "" here; map that back to "-", the sentinel the rest of
+				// the package uses for "no salt", the same way a/aaaa get
+				// a dedicated case below.
+				fmt.Fprintf(b, `if shadow.%s == "" {
+shadow.%s = "-"
+}
+rr.%s = shadow.%s
+`, field, field, field, field)
+				continue
+			}
+
+			switch st.Tag(i) {
+			case `dns:"a"`, `dns:"aaaa"`:
+				fmt.Fprintf(b, `ip := net.ParseIP(shadow.%s)
+if ip == nil {
+return fmt.Errorf("dns: invalid IP address %%q for %s.%s", shadow.%s)
+}
+rr.%s = ip
+`, field, name, field, field, field)
+			case `dns:"opt"`:
+				fmt.Fprintf(b, `options, err := unmarshalEDNS0Slice(shadow.%s)
+if err != nil {
+return err
+}
+rr.%s = options
+`, field, field)
+			case `dns:"pairs"`:
+				fmt.Fprintf(b, `pairs, err := unmarshalSVCBSlice(shadow.%s)
+if err != nil {
+return err
+}
+rr.%s = pairs
+`, field, field)
+			default:
+				fmt.Fprintf(b, "rr.%s = shadow.%s\n", field, field)
+			}
+		}
+		fmt.Fprint(b, "return nil\n}\n\n")
+	}
+}
+
+// genJSONRoundTripTest emits one TestJSONRoundTrip_<Name>(t *testing.T) per
+// RR type, built from the same per-tag seedExpr values fuzz_generate.go
+// uses for its corpus seeds. Each test drives the full wire -> RR -> JSON
+// -> RR -> wire chain the request asked for: pack a seeded instance,
+// unpack it back (so downcasing/compression choices are normalized the
+// same way a real caller would see them), marshal/unmarshal through JSON,
+// then repack and compare. RR types with a GatewayType field additionally
+// force the IP-gateway branch (GatewayType 1, GatewayAddr set) rather than
+// leaving it at the "no gateway" zero value, since GatewayAddr is folded
+// into the sibling ipsechost/amtrelayhost field and only round-trips
+// through that branch.
+func genJSONRoundTripTest(b *bytes.Buffer, namedTypes []string, scope *types.Scope) {
+	for _, name := range namedTypes {
+		o := scope.Lookup(name)
+		st, _ := getTypeStruct(o.Type(), scope)
+
+		fmt.Fprintf(b, "func TestJSONRoundTrip_%s(t *testing.T) {\n", name)
+		fmt.Fprintf(b, "rr := new(%s)\n", name)
+		fmt.Fprintf(b, "rr.Hdr = RR_Header{Name: \".\", Rrtype: Type%s, Class: ClassINET}\n", name)
+
+		hasGateway := false
+		for i := 1; i < st.NumFields(); i++ {
+			field := st.Field(i).Name()
+			tag := st.Tag(i)
+
+			if field == "GatewayType" {
+				// seedExpr seeds this untagged uint8 field to 1 below,
+				// same as any other; note that so GatewayAddr, whose
+				// own tag is dns:"-", gets seeded to match.
+				hasGateway = true
+			}
+			if tag == `dns:"-"` {
+				continue
+			}
+			if _, ok := st.Field(i).Type().(*types.Slice); ok {
+				// Slice-typed RDATA round-trips fine starting from
+				// nil; the seed doesn't need to populate it.
+				continue
+			}
+			if expr, ok := seedExpr(tag, st.Field(i).Type()); ok {
+				fmt.Fprintf(b, "rr.%s = %s\n", field, expr)
+			}
+		}
+		if hasGateway {
+			fmt.Fprintln(b, "rr.GatewayAddr = net.IPv4(192, 0, 2, 1).To4()")
+		}
+
+		fmt.Fprintln(b, `msg := make([]byte, maxRDLengthFuzz)
+off, err := rr.pack(msg, 0, compressionMap{}, false)
+if err != nil {
+t.Fatalf("pack seed: %v", err)
+}
+seed := new(`+name+`)
+if err := seed.unpack(msg[:off], msg[:off]); err != nil {
+t.Fatalf("unpack seed: %v", err)
+}
+
+data, err := seed.MarshalJSON()
+if err != nil {
+t.Fatalf("MarshalJSON: %v", err)
+}
+
+rr2 := new(`+name+`)
+if err := rr2.UnmarshalJSON(data); err != nil {
+t.Fatalf("UnmarshalJSON: %v", err)
+}
+
+out := make([]byte, maxRDLengthFuzz)
+off2, err := rr2.pack(out, 0, compressionMap{}, false)
+if err != nil {
+t.Fatalf("pack after JSON round trip: %v", err)
+}
+if off2 > len(out) {
+t.Fatalf("pack wrote past preallocated buffer: off=%d", off2)
+}`)
+
+		if domainNameUnstable(st) {
+			fmt.Fprintln(b, `if !reflect.DeepEqual(seed, rr2) {
+t.Fatalf("JSON round trip not stable: %#v vs %#v", seed, rr2)
+}`)
+		} else {
+			fmt.Fprintln(b, `if off2 != off || !bytes.Equal(out[:off2], msg[:off]) {
+t.Fatalf("JSON round trip mismatch: %x vs %x", msg[:off], out[:off2])
+}`)
+		}
+		fmt.Fprintln(b, "}\n")
+	}
+}
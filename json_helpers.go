@@ -0,0 +1,74 @@
+package dns
+
+// jsonEDNS0 is the JSON wire form of a single EDNS0 option. EDNS0 is an
+// interface, which encoding/json can marshal (it just calls the concrete
+// type's fields) but can never unmarshal on its own — there's no way for
+// it to pick a concrete type to allocate. We round-trip through the raw
+// option code and payload instead of a per-option-type registry: Data is
+// exactly what the option's own pack method would write, so reconstructing
+// it as an EDNS0_LOCAL of that code preserves the wire bytes even though
+// the concrete Go type backing the interface may differ from the original
+// (e.g. an EDNS0_NSID comes back as an EDNS0_LOCAL with the same code and
+// data).
+type jsonEDNS0 struct {
+	Code uint16 `json:"code"`
+	Data []byte `json:"data"`
+}
+
+func marshalEDNS0Slice(options []EDNS0) ([]jsonEDNS0, error) {
+	out := make([]jsonEDNS0, 0, len(options))
+	for _, o := range options {
+		data, err := o.pack()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, jsonEDNS0{Code: o.Option(), Data: data})
+	}
+	return out, nil
+}
+
+func unmarshalEDNS0Slice(in []jsonEDNS0) ([]EDNS0, error) {
+	out := make([]EDNS0, 0, len(in))
+	for _, j := range in {
+		local := &EDNS0_LOCAL{Code: j.Code}
+		if err := local.unpack(j.Data); err != nil {
+			return nil, err
+		}
+		out = append(out, local)
+	}
+	return out, nil
+}
+
+// jsonSVCBKeyValue is the JSON wire form of a single SVCB/HTTPS SvcParam,
+// round-tripped through its raw key and payload for the same reason
+// jsonEDNS0 does: SVCBKeyValue is an interface, so unmarshal has nothing
+// to instantiate without a concrete type to land on. SVCBLocal is SVCB's
+// own fallback for an unrecognized key, and serves the same purpose here.
+type jsonSVCBKeyValue struct {
+	Key  SVCBKey `json:"key"`
+	Data []byte  `json:"data"`
+}
+
+func marshalSVCBSlice(pairs []SVCBKeyValue) ([]jsonSVCBKeyValue, error) {
+	out := make([]jsonSVCBKeyValue, 0, len(pairs))
+	for _, p := range pairs {
+		data, err := p.pack()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, jsonSVCBKeyValue{Key: p.Key(), Data: data})
+	}
+	return out, nil
+}
+
+func unmarshalSVCBSlice(in []jsonSVCBKeyValue) ([]SVCBKeyValue, error) {
+	out := make([]SVCBKeyValue, 0, len(in))
+	for _, j := range in {
+		local := &SVCBLocal{KeyCode: j.Key}
+		if err := local.unpack(j.Data); err != nil {
+			return nil, err
+		}
+		out = append(out, local)
+	}
+	return out, nil
+}
@@ -4,7 +4,19 @@
 // msg_generate.go is meant to run with go generate. It will use
 // go/{importer,types} to track down all the RR struct types. Then for each type
 // it will generate pack/unpack methods based on the struct tags. The generated source is
-// written to zmsg.go, and is meant to be checked into git.
+// written to zmsg.go and zmsg_builder.go, and is meant to be checked into git.
+//
+// zmsg.go holds the original, imperative pack implementation that threads a
+// manual byte offset through the pack* helpers. zmsg_builder.go holds a
+// symmetric pack implementation driven by cryptobyte.Builder, mirroring the
+// cryptobyte.String-based unpack side. The two are mutually exclusive build
+// variants selected with the "dnsbuilder" build tag; both are regenerated
+// every time so they never drift apart.
+//
+// The go/types plumbing (loadModule, getTypeStruct, namedRRTypes) is shared
+// with json_generate.go and fuzz_generate.go via gen_common.go:
+//
+//	go run msg_generate.go gen_common.go
 package main
 
 import (
@@ -15,11 +27,11 @@ import (
 	"log"
 	"os"
 	"strings"
-
-	"golang.org/x/tools/go/packages"
 )
 
-var packageHdr = `
+var packageHdrOffset = `
+//go:build !dnsbuilder
+
 // Code generated by "go run msg_generate.go"; DO NOT EDIT.
 
 package dns
@@ -28,38 +40,29 @@ import "golang.org/x/crypto/cryptobyte"
 
 `
 
-// getTypeStruct will take a type and the package scope, and return the
-// (innermost) struct if the type is considered a RR type (currently defined as
-// those structs beginning with a RR_Header, could be redefined as implementing
-// the RR interface). The bool return value indicates if embedded structs were
-// resolved.
-func getTypeStruct(t types.Type, scope *types.Scope) (*types.Struct, bool) {
-	st, ok := t.Underlying().(*types.Struct)
-	if !ok {
-		return nil, false
-	}
-	if st.NumFields() == 0 {
-		return nil, false
-	}
-	if st.Field(0).Type() == scope.Lookup("RR_Header").Type() {
-		return st, false
-	}
-	if st.Field(0).Anonymous() {
-		st, _ := getTypeStruct(st.Field(0).Type(), scope)
-		return st, true
-	}
-	return nil, false
-}
+var packageHdrBuilder = `
+//go:build dnsbuilder
 
-// loadModule retrieves package description for a given module.
-func loadModule(name string) (*types.Package, error) {
-	conf := packages.Config{Mode: packages.NeedTypes | packages.NeedTypesInfo}
-	pkgs, err := packages.Load(&conf, name)
-	if err != nil {
-		return nil, err
-	}
-	return pkgs[0].Types, nil
-}
+// Code generated by "go run msg_generate.go"; DO NOT EDIT.
+//
+// This is the cryptobyte.Builder-driven counterpart to zmsg.go, built with
+// -tags dnsbuilder. pack writes into a cryptobyte.Builder seeded with
+// msg[:off] so that Builder.Len() always reports the true offset of the
+// byte about to be written, which is what lets name compression work
+// without the Builder knowing anything about DNS pointers. The field-level
+// pack*Builder helpers live in msg_helpers_builder.go.
+//
+// Builder.Bytes() can only hand back a different backing array than msg if
+// it had to grow past cap(msg); pack treats that as a hard error
+// (errBuilderBufferGrew) rather than returning an off1 that points at
+// bytes the caller can't see, so callers must still pre-size msg exactly
+// as they do for the zmsg.go pack path.
+
+package dns
+
+import "golang.org/x/crypto/cryptobyte"
+
+`
 
 func main() {
 	// Import and type-check the package
@@ -67,32 +70,28 @@ func main() {
 	fatalIfErr(err)
 	scope := pkg.Scope()
 
-	// Collect actual types (*X)
-	var namedTypes []string
-	for _, name := range scope.Names() {
-		o := scope.Lookup(name)
-		if o == nil || !o.Exported() {
-			continue
-		}
-		if st, _ := getTypeStruct(o.Type(), scope); st == nil {
-			continue
-		}
-		if name == "PrivateRR" {
-			continue
-		}
-
-		// Check if corresponding TypeX exists
-		if scope.Lookup("Type"+o.Name()) == nil && o.Name() != "RFC3597" {
-			log.Fatalf("Constant Type%s does not exist.", o.Name())
-		}
+	namedTypes := namedRRTypes(scope)
 
-		namedTypes = append(namedTypes, o.Name())
-	}
+	bOffset := &bytes.Buffer{}
+	bOffset.WriteString(packageHdrOffset)
+	fmt.Fprint(bOffset, "// pack*() functions\n\n")
+	genPackOffset(bOffset, namedTypes, scope)
+	fmt.Fprint(bOffset, "// unpack*() functions\n\n")
+	genUnpack(bOffset, namedTypes, scope)
+	writeGofmt("zmsg.go", bOffset)
 
-	b := &bytes.Buffer{}
-	b.WriteString(packageHdr)
+	bBuilder := &bytes.Buffer{}
+	bBuilder.WriteString(packageHdrBuilder)
+	fmt.Fprint(bBuilder, "// pack*() functions\n\n")
+	genPackBuilder(bBuilder, namedTypes, scope)
+	fmt.Fprint(bBuilder, "// unpack*() functions\n\n")
+	genUnpack(bBuilder, namedTypes, scope)
+	writeGofmt("zmsg_builder.go", bBuilder)
+}
 
-	fmt.Fprint(b, "// pack*() functions\n\n")
+// genPackOffset emits the imperative, manual-offset pack methods that thread
+// an `off int` cursor through the pack* helpers.
+func genPackOffset(b *bytes.Buffer, namedTypes []string, scope *types.Scope) {
 	for _, name := range namedTypes {
 		o := scope.Lookup(name)
 		st, _ := getTypeStruct(o.Type(), scope)
@@ -196,8 +195,143 @@ if rr.%s != "-" {
 		}
 		fmt.Fprint(b, "return off, nil }\n\n")
 	}
+}
 
-	fmt.Fprint(b, "// unpack*() functions\n\n")
+// genPackBuilder emits cryptobyte.Builder-driven pack methods. They keep the
+// same (msg []byte, off int, compression compressionMap, compress bool)
+// signature as the offset-based pack methods in zmsg.go so that callers
+// don't need to know which variant they're linked against; internally a
+// Builder is seeded with msg[:off] and bb.Len() stands in for the off
+// cursor, which is what lets packDomainNameBuilder compute compression
+// pointers without the Builder knowing about DNS semantics.
+func genPackBuilder(b *bytes.Buffer, namedTypes []string, scope *types.Scope) {
+	for _, name := range namedTypes {
+		o := scope.Lookup(name)
+		st, _ := getTypeStruct(o.Type(), scope)
+
+		fmt.Fprintf(b, "func (rr *%s) pack(msg []byte, off int, compression compressionMap, compress bool) (off1 int, err error) {\n", name)
+		fmt.Fprintln(b, "bb := cryptobyte.NewBuilder(msg[:off])")
+		for i := 1; i < st.NumFields(); i++ {
+			o := func(s string) {
+				fmt.Fprintf(b, s, st.Field(i).Name())
+				fmt.Fprint(b, `if err != nil {
+return off, err
+}
+`)
+			}
+
+			if _, ok := st.Field(i).Type().(*types.Slice); ok {
+				switch st.Tag(i) {
+				case `dns:"-"`: // ignored
+				case `dns:"txt"`:
+					o("err = packStringTxtBuilder(bb, rr.%s)\n")
+				case `dns:"opt"`:
+					o("err = packDataOptBuilder(bb, rr.%s)\n")
+				case `dns:"nsec"`:
+					o("err = packDataNsecBuilder(bb, rr.%s)\n")
+				case `dns:"pairs"`:
+					// SvcParam values are themselves length-prefixed, so
+					// packDataSVCBBuilder nests an AddLengthPrefixed group
+					// per pair inside the outer RDATA.
+					o("err = packDataSVCBBuilder(bb, rr.%s)\n")
+				case `dns:"domain-name"`:
+					o("err = packDataDomainNamesBuilder(bb, rr.%s, compression, false)\n")
+				case `dns:"apl"`:
+					o("err = packDataAplBuilder(bb, rr.%s)\n")
+				default:
+					log.Fatalln(name, st.Field(i).Name(), st.Tag(i))
+				}
+				continue
+			}
+
+			switch {
+			case st.Tag(i) == `dns:"-"`: // ignored
+			case st.Tag(i) == `dns:"cdomain-name"`:
+				o("err = packDomainNameBuilder(bb, rr.%s, compression, compress)\n")
+			case st.Tag(i) == `dns:"domain-name"`:
+				o("err = packDomainNameBuilder(bb, rr.%s, compression, false)\n")
+			case st.Tag(i) == `dns:"a"`:
+				o("err = packDataABuilder(bb, rr.%s)\n")
+			case st.Tag(i) == `dns:"aaaa"`:
+				o("err = packDataAAAABuilder(bb, rr.%s)\n")
+			case st.Tag(i) == `dns:"uint48"`:
+				fmt.Fprintf(b, "bb.AddUint48(rr.%s)\n", st.Field(i).Name())
+			case st.Tag(i) == `dns:"txt"`:
+				o("err = packStringBuilder(bb, rr.%s)\n")
+
+			case strings.HasPrefix(st.Tag(i), `dns:"size-base32`): // size-base32 can be packed just like base32
+				fallthrough
+			case st.Tag(i) == `dns:"base32"`:
+				o("err = packStringBase32Builder(bb, rr.%s)\n")
+
+			case strings.HasPrefix(st.Tag(i), `dns:"size-base64`): // size-base64 can be packed just like base64
+				fallthrough
+			case st.Tag(i) == `dns:"base64"`:
+				o("err = packStringBase64Builder(bb, rr.%s)\n")
+
+			case strings.HasPrefix(st.Tag(i), `dns:"size-hex:SaltLength`):
+				// directly write instead of using o() so we get the error check in the correct place
+				field := st.Field(i).Name()
+				fmt.Fprintf(b, `// Only pack salt if value is not "-", i.e. empty
+if rr.%s != "-" {
+  err = packStringHexBuilder(bb, rr.%s)
+  if err != nil {
+    return off, err
+  }
+}
+`, field, field)
+				continue
+			case strings.HasPrefix(st.Tag(i), `dns:"size-hex`): // size-hex can be packed just like hex
+				fallthrough
+			case st.Tag(i) == `dns:"hex"`:
+				o("err = packStringHexBuilder(bb, rr.%s)\n")
+			case st.Tag(i) == `dns:"any"`:
+				o("err = packStringAnyBuilder(bb, rr.%s)\n")
+			case st.Tag(i) == `dns:"octet"`:
+				o("err = packStringOctetBuilder(bb, rr.%s)\n")
+			case st.Tag(i) == `dns:"ipsechost"` || st.Tag(i) == `dns:"amtrelayhost"`:
+				o("err = packIPSECGatewayBuilder(bb, rr.GatewayAddr, rr.%s, rr.GatewayType, compression, false)\n")
+			case st.Tag(i) == "":
+				switch st.Field(i).Type().(*types.Basic).Kind() {
+				case types.Uint8:
+					fmt.Fprintf(b, "bb.AddUint8(rr.%s)\n", st.Field(i).Name())
+				case types.Uint16:
+					fmt.Fprintf(b, "bb.AddUint16(rr.%s)\n", st.Field(i).Name())
+				case types.Uint32:
+					fmt.Fprintf(b, "bb.AddUint32(rr.%s)\n", st.Field(i).Name())
+				case types.Uint64:
+					fmt.Fprintf(b, "bb.AddUint64(rr.%s)\n", st.Field(i).Name())
+				case types.String:
+					o("err = packStringBuilder(bb, rr.%s)\n")
+				default:
+					log.Fatalln(name, st.Field(i).Name())
+				}
+			default:
+				log.Fatalln(name, st.Field(i).Name(), st.Tag(i))
+			}
+		}
+		fmt.Fprint(b, `out, err := bb.Bytes()
+if err != nil {
+return off, err
+}
+// Bytes() can only exceed cap(msg) by growing onto a new backing
+// array that the caller, which still only sees off1, has no way to
+// observe; fail loudly instead of returning a bogus offset into
+// bytes nobody can reach.
+if len(out) > cap(msg) {
+return off, errBuilderBufferGrew
+}
+return len(out), nil }
+
+`)
+	}
+}
+
+// genUnpack emits the cryptobyte.String-driven unpack methods. These are
+// shared verbatim between zmsg.go and zmsg_builder.go: unpack never needed
+// the manual offset cursor pack does, so there's nothing for the Builder
+// variant to change here.
+func genUnpack(b *bytes.Buffer, namedTypes []string, scope *types.Scope) {
 	for _, name := range namedTypes {
 		o := scope.Lookup(name)
 		st, _ := getTypeStruct(o.Type(), scope)
@@ -323,36 +457,18 @@ if rr.%s != "-" {
 		fmt.Fprintln(b, "if !s.Empty() { return errTrailingRData }")
 		fmt.Fprint(b, "return nil }\n\n")
 	}
+}
 
-	// gofmt
+// writeGofmt formats b and writes the result to name.
+func writeGofmt(name string, b *bytes.Buffer) {
 	res, err := format.Source(b.Bytes())
 	if err != nil {
 		b.WriteTo(os.Stderr)
 		log.Fatal(err)
 	}
 
-	// write result
-	f, err := os.Create("zmsg.go")
+	f, err := os.Create(name)
 	fatalIfErr(err)
 	defer f.Close()
 	f.Write(res)
 }
-
-// structMember will take a tag like dns:"size-base32:SaltLength" and return the last part of this string.
-func structMember(s string) string {
-	idx := strings.LastIndex(s, ":")
-	return strings.TrimSuffix(s[idx+1:], `"`)
-}
-
-// structTag will take a tag like dns:"size-base32:SaltLength" and return base32.
-func structTag(s string) string {
-	s = strings.TrimPrefix(s, `dns:"size-`)
-	s, _, _ = strings.Cut(s, ":")
-	return s
-}
-
-func fatalIfErr(err error) {
-	if err != nil {
-		log.Fatal(err)
-	}
-}
@@ -0,0 +1,229 @@
+//go:build dnsbuilder
+
+package dns
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// errBuilderBufferGrew is returned by the generated pack methods in
+// zmsg_builder.go when the underlying cryptobyte.Builder had to grow past
+// cap(msg) to fit the RDATA. When that happens Builder.Bytes() hands back
+// bytes on a different backing array than msg, which the (msg []byte, off
+// int) pack signature has no way to surface to the caller, so we refuse to
+// report a misleading off1 instead.
+var errBuilderBufferGrew = &Error{err: "dns: builder grew past preallocated message buffer"}
+
+// scratchPool reuses the scratch buffers packViaScratch hands to the
+// offset-based pack* helpers it adapts, instead of allocating (and
+// zeroing) a fresh off+scratchLen buffer on every call. fn only ever
+// writes to scratch[off:], so whatever a pooled buffer's [:off] prefix
+// still holds from some earlier, unrelated message is never read back;
+// only cap(buf) growing past what's already pooled costs an allocation.
+var scratchPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// packViaScratch adapts an existing offset-based pack helper (the ones
+// zmsg.go's pack methods already call) to the Builder-driven path. fn is
+// run against a scratch buffer seeded with the same absolute offset
+// bb.Len() reports, which is what packDomainName and friends need to
+// record and resolve compression pointers correctly: the scratch array
+// itself is never seen by the caller, only the bytes fn actually wrote are
+// appended to bb, so the offsets it records in compression remain valid
+// even though the bytes aren't physically stored in msg until bb.Bytes()
+// runs.
+//
+// packDomainName and friends need an absolute off into the eventual
+// message (compression pointers are encoded as absolute offsets). Every
+// helper below except packDataOptBuilder and packDataSVCBBuilder goes
+// through this, including the character-string, hex/base32/base64, A/AAAA,
+// NSEC, APL and gateway helpers whose output does not depend on off; those
+// two alone write straight into bb with AddUint16LengthPrefixed.
+//
+// scratchLen must be an upper bound on the number of bytes fn can write
+// beyond off; it does not need to be exact.
+func packViaScratch(bb *cryptobyte.Builder, scratchLen int, fn func(scratch []byte, off int) (int, error)) error {
+	off := bb.Len()
+	need := off + scratchLen
+
+	bufp := scratchPool.Get().(*[]byte)
+	buf := *bufp
+	if cap(buf) < need {
+		buf = make([]byte, need)
+	} else {
+		buf = buf[:need]
+		// A pooled buffer's [off:need] tail can still hold a previous
+		// message's bytes. Most fn implementations fully overwrite
+		// every byte they're given, but packDataNsec ORs individual
+		// bits into a window's bytes rather than writing all of them,
+		// so leftover bits from a reused buffer would otherwise leak
+		// into the packed bitmap.
+		tail := buf[off:need]
+		for i := range tail {
+			tail[i] = 0
+		}
+	}
+
+	off1, err := fn(buf, off)
+
+	*bufp = buf
+	scratchPool.Put(bufp)
+
+	if err != nil {
+		return err
+	}
+	bb.AddBytes(buf[off:off1])
+	return nil
+}
+
+func packDomainNameBuilder(bb *cryptobyte.Builder, name string, compression compressionMap, compress bool) error {
+	return packViaScratch(bb, len(name)+2, func(scratch []byte, off int) (int, error) {
+		return packDomainName(name, scratch, off, compression, compress)
+	})
+}
+
+func packDataDomainNamesBuilder(bb *cryptobyte.Builder, names []string, compression compressionMap, compress bool) error {
+	n := 0
+	for _, name := range names {
+		n += len(name) + 2
+	}
+	return packViaScratch(bb, n, func(scratch []byte, off int) (int, error) {
+		return packDataDomainNames(names, scratch, off, compression, compress)
+	})
+}
+
+func packDataABuilder(bb *cryptobyte.Builder, a net.IP) error {
+	return packViaScratch(bb, net.IPv4len, func(scratch []byte, off int) (int, error) {
+		return packDataA(a, scratch, off)
+	})
+}
+
+func packDataAAAABuilder(bb *cryptobyte.Builder, aaaa net.IP) error {
+	return packViaScratch(bb, net.IPv6len, func(scratch []byte, off int) (int, error) {
+		return packDataAAAA(aaaa, scratch, off)
+	})
+}
+
+func packStringBuilder(bb *cryptobyte.Builder, s string) error {
+	return packViaScratch(bb, len(s)+1, func(scratch []byte, off int) (int, error) {
+		return packString(s, scratch, off)
+	})
+}
+
+func packStringTxtBuilder(bb *cryptobyte.Builder, ss []string) error {
+	n := 0
+	for _, s := range ss {
+		n += len(s) + 1
+	}
+	return packViaScratch(bb, n, func(scratch []byte, off int) (int, error) {
+		return packStringTxt(ss, scratch, off)
+	})
+}
+
+func packStringBase32Builder(bb *cryptobyte.Builder, s string) error {
+	return packViaScratch(bb, len(s)+1, func(scratch []byte, off int) (int, error) {
+		return packStringBase32(s, scratch, off)
+	})
+}
+
+func packStringBase64Builder(bb *cryptobyte.Builder, s string) error {
+	return packViaScratch(bb, len(s)+1, func(scratch []byte, off int) (int, error) {
+		return packStringBase64(s, scratch, off)
+	})
+}
+
+func packStringHexBuilder(bb *cryptobyte.Builder, s string) error {
+	return packViaScratch(bb, len(s)/2+1, func(scratch []byte, off int) (int, error) {
+		return packStringHex(s, scratch, off)
+	})
+}
+
+func packStringAnyBuilder(bb *cryptobyte.Builder, s string) error {
+	return packViaScratch(bb, len(s)+1, func(scratch []byte, off int) (int, error) {
+		return packStringAny(s, scratch, off)
+	})
+}
+
+func packStringOctetBuilder(bb *cryptobyte.Builder, s string) error {
+	return packViaScratch(bb, len(s)+1, func(scratch []byte, off int) (int, error) {
+		return packStringOctet(s, scratch, off)
+	})
+}
+
+// packDataOptBuilder writes options straight into bb: each EDNS0 option is
+// an OPTION-CODE/OPTION-LENGTH/OPTION-DATA triple where OPTION-DATA is
+// already-opaque bytes from el.pack(), so AddUint16LengthPrefixed computes
+// and patches the length itself instead of this needing to know off or
+// pre-size a scratch buffer at all.
+func packDataOptBuilder(bb *cryptobyte.Builder, options []EDNS0) error {
+	for _, el := range options {
+		b, err := el.pack()
+		if err != nil {
+			return err
+		}
+		bb.AddUint16(el.Option())
+		bb.AddUint16LengthPrefixed(func(child *cryptobyte.Builder) {
+			child.AddBytes(b)
+		})
+	}
+	return nil
+}
+
+// packDataSVCBBuilder writes pairs straight into bb: each SvcParam is a
+// SvcParamKey/SvcParamValue pair where the value is already-opaque bytes
+// from el.pack(), nested as an AddUint16LengthPrefixed group per pair
+// inside the outer RDATA so its length is computed and patched by the
+// Builder rather than by manual offset arithmetic.
+func packDataSVCBBuilder(bb *cryptobyte.Builder, pairs []SVCBKeyValue) error {
+	for _, el := range pairs {
+		b, err := el.pack()
+		if err != nil {
+			return err
+		}
+		bb.AddUint16(uint16(el.Key()))
+		bb.AddUint16LengthPrefixed(func(child *cryptobyte.Builder) {
+			child.AddBytes(b)
+		})
+	}
+	return nil
+}
+
+// aplPrefixMaxLen is a per-prefix upper bound for packDataAplBuilder's
+// scratch buffer: a 2-byte address family, a 1-byte prefix length, a
+// 1-byte AFDLENGTH/negation-flag byte, and the address itself, which
+// packDataApl trims to at most net.IPv6len bytes.
+const aplPrefixMaxLen = 2 + 1 + 1 + net.IPv6len
+
+// packDataAplBuilder adapts packDataApl via packViaScratch rather than
+// reimplementing it directly: an APLPrefix's AFDLENGTH/negation-flag byte
+// and its address trimming depend on prefix-length arithmetic that already
+// lives in packDataApl, and duplicating it here would just be a second
+// place for that logic to drift out of sync. Unlike the old flat
+// maxRDLength scratch size, the bound here is sized off the actual
+// prefixes being packed.
+func packDataAplBuilder(bb *cryptobyte.Builder, prefixes []APLPrefix) error {
+	return packViaScratch(bb, len(prefixes)*aplPrefixMaxLen, func(scratch []byte, off int) (int, error) {
+		return packDataApl(prefixes, scratch, off)
+	})
+}
+
+// nsecBitmapMaxLen is the largest a type bitmap (RFC 4034 §4.1.2) can be:
+// 256 windows of a 1-byte window number, a 1-byte length, and up to 32
+// bytes of bitmap each.
+const nsecBitmapMaxLen = 256 * (1 + 1 + 32)
+
+func packDataNsecBuilder(bb *cryptobyte.Builder, rrtypes []uint16) error {
+	return packViaScratch(bb, nsecBitmapMaxLen, func(scratch []byte, off int) (int, error) {
+		return packDataNsec(rrtypes, scratch, off)
+	})
+}
+
+func packIPSECGatewayBuilder(bb *cryptobyte.Builder, addr net.IP, host string, gatewayType uint8, compression compressionMap, compress bool) error {
+	return packViaScratch(bb, len(host)+net.IPv6len+2, func(scratch []byte, off int) (int, error) {
+		return packIPSECGateway(addr, host, scratch, off, gatewayType, compression, compress)
+	})
+}